@@ -0,0 +1,79 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewStatusCommand returns the `vcluster certs status` subcommand, which prints the CN, SANs,
+// issuer and remaining lifetime of every cert in the <vclustername>-certs Secret -- the
+// operational visibility users currently have to get by running `openssl x509` by hand.
+func NewStatusCommand(client kubernetes.Interface, namespace, vClusterName string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Print the CN, SANs, issuer and remaining lifetime of every vcluster cert",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runCertsStatus(cmd.Context(), client, namespace, vClusterName, cmd.OutOrStdout())
+		},
+	}
+}
+
+func runCertsStatus(ctx context.Context, client kubernetes.Interface, namespace, vClusterName string, out io.Writer) error {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, vClusterName+"-certs", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get certs secret: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tCN\tSANS\tISSUER\tEXPIRES IN")
+
+	for fromName, toName := range certMap {
+		if !strings.HasSuffix(fromName, ".crt") {
+			continue
+		}
+
+		data, ok := secret.Data[toName]
+		if !ok {
+			continue
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		sans := append(append([]string{}, cert.DNSNames...), ipStrings(cert.IPAddresses)...)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			fromName,
+			cert.Subject.CommonName,
+			strings.Join(sans, ","),
+			cert.Issuer.CommonName,
+			time.Until(cert.NotAfter).Round(time.Hour),
+		)
+	}
+
+	return w.Flush()
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, len(ips))
+	for i, ip := range ips {
+		out[i] = ip.String()
+	}
+	return out
+}
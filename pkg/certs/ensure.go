@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/exp/maps"
@@ -18,6 +19,10 @@ import (
 	"k8s.io/klog/v2"
 )
 
+// EnsureCerts keeps private PKI material (ca.key, sa.key, the etcd CA key, ...) in the same
+// <vclustername>-certs Secret as everything else. Use EnsureCertsWithStore to keep that material
+// in a dedicated CertStore instead, e.g. for compliance requirements that keep CA keys out of a
+// plain Secret.
 func EnsureCerts(
 	ctx context.Context,
 	serviceCIDR string,
@@ -28,13 +33,53 @@ func EnsureCerts(
 	clusterDomain string,
 	etcdSans []string,
 ) error {
+	return EnsureCertsWithStore(ctx, serviceCIDR, currentNamespace, currentNamespaceClient, vClusterName, certificateDir, clusterDomain, etcdSans, StoreConfig{Type: StoreTypeSecret})
+}
+
+// EnsureCertsWithStore behaves like EnsureCerts, but reads/writes the private material listed in
+// privateMaterialKeys through the CertStore built from storeCfg instead of always keeping it in
+// the <vclustername>-certs Secret. Public certs always stay in the Secret so components that just
+// need to trust the cluster can start without talking to the store.
+func EnsureCertsWithStore(
+	ctx context.Context,
+	serviceCIDR string,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+	clusterDomain string,
+	etcdSans []string,
+	storeCfg StoreConfig,
+) error {
+	return EnsureCertsWithOptions(ctx, serviceCIDR, currentNamespace, currentNamespaceClient, vClusterName, certificateDir, clusterDomain, etcdSans, CertsOptions{Store: storeCfg})
+}
+
+// EnsureCertsWithOptions is the fullest form of EnsureCerts: besides storage (opts.Store), it
+// accepts opts.ExternalCAs so the apiserver/front-proxy/etcd CAs can chain to a CA the caller
+// already controls instead of always minting a fresh self-signed one.
+func EnsureCertsWithOptions(
+	ctx context.Context,
+	serviceCIDR string,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+	clusterDomain string,
+	etcdSans []string,
+	opts CertsOptions,
+) error {
+	store, err := newCertStore(ctx, opts.Store, currentNamespaceClient, currentNamespace, vClusterName)
+	if err != nil {
+		return fmt.Errorf("build cert store: %w", err)
+	}
+
 	// we create a certificate for up to 20 etcd replicas, this should be sufficient for most use cases. Eventually we probably
 	// want to update this to the actual etcd number, but for now this is the easiest way to allow up and downscaling without
 	// regenerating certificates.
 	secretName := vClusterName + "-certs"
 	secret, err := currentNamespaceClient.CoreV1().Secrets(currentNamespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err == nil {
-		return downloadCertsFromSecret(secret, certificateDir)
+		return downloadCerts(ctx, secret, store, certificateDir)
 	}
 
 	// init config
@@ -55,17 +100,31 @@ func EnsureCerts(
 	cfg.CertificatesDir = certificateDir
 	cfg.LocalAPIEndpoint.AdvertiseAddress = "0.0.0.0"
 	cfg.LocalAPIEndpoint.BindPort = 443
+
+	if err := seedExternalCAs(ctx, currentNamespaceClient, currentNamespace, certificateDir, opts.ExternalCAs); err != nil {
+		return fmt.Errorf("seed external ca: %w", err)
+	}
+
 	// the directory alone already exists on new install for k8s and eks
 	_, err = os.Stat(filepath.Join(certificateDir, "sa.key"))
 	if errors.Is(err, fs.ErrNotExist) {
 		// only create the files if there is no directory there already
-		err = CreatePKIAssets(cfg)
+		err = createPKIAssets(cfg, opts.ExternalCAs)
 		if err != nil {
 			return fmt.Errorf("create pki assets: %w", err)
 		}
-		err = CreateJoinControlPlaneKubeConfigFiles(cfg.CertificatesDir, cfg)
-		if err != nil {
-			return fmt.Errorf("create kube configs: %w", err)
+		if !requiresCertManagerLeaves(externalCAFor("apiserver", opts.ExternalCAs)) {
+			err = CreateJoinControlPlaneKubeConfigFiles(cfg.CertificatesDir, cfg)
+			if err != nil {
+				return fmt.Errorf("create kube configs: %w", err)
+			}
+		}
+	}
+
+	if opts.ExternalCAs != nil {
+		dnsNames, ips := apiServerSANs(cfg)
+		if err := requestCertManagerCerts(ctx, opts.CertManagerClient, currentNamespaceClient, currentNamespace, vClusterName, certificateDir, dnsNames, ips, etcdSans, opts.ExternalCAs, cfg.ControlPlaneEndpoint); err != nil {
+			return fmt.Errorf("request certs from cert-manager: %w", err)
 		}
 	}
 
@@ -74,6 +133,11 @@ func EnsureCerts(
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
 			Namespace: currentNamespace,
+			Annotations: map[string]string{
+				annotationServiceCIDR:   serviceCIDR,
+				annotationClusterDomain: clusterDomain,
+				annotationEtcdSans:      strings.Join(etcdSans, ","),
+			},
 		},
 		Data: map[string][]byte{},
 	}
@@ -83,6 +147,13 @@ func EnsureCerts(
 			return fmt.Errorf("read %s: %w", fromName, err)
 		}
 
+		if store != nil && privateMaterialKeys[fromName] {
+			if err := store.Put(ctx, toName, data); err != nil {
+				return fmt.Errorf("put %s into cert store: %w", toName, err)
+			}
+			continue
+		}
+
 		secret.Data[toName] = data
 	}
 	extraFiles, err := extraFiles(certificateDir)
@@ -109,7 +180,45 @@ func EnsureCerts(
 		klog.Infof("Successfully created certs secret %s/%s", currentNamespace, secretName)
 	}
 
-	return downloadCertsFromSecret(secret, certificateDir)
+	return downloadCerts(ctx, secret, store, certificateDir)
+}
+
+// downloadCerts writes every field from the secret to certificateDir via downloadCertsFromSecret,
+// then pulls any private material listed in privateMaterialKeys back from store, if one is
+// configured. It is a no-op extension of downloadCertsFromSecret when store is nil.
+func downloadCerts(
+	ctx context.Context,
+	secret *corev1.Secret,
+	store CertStore,
+	certificateDir string,
+) error {
+	if err := downloadCertsFromSecret(secret, certificateDir); err != nil {
+		return err
+	}
+	if store == nil {
+		return nil
+	}
+
+	for fromName, toName := range certMap {
+		if !privateMaterialKeys[fromName] {
+			continue
+		}
+
+		data, err := store.Get(ctx, toName)
+		if err != nil {
+			return fmt.Errorf("get %s from cert store: %w", toName, err)
+		}
+
+		path := filepath.Join(certificateDir, fromName)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return fmt.Errorf("create directory %s: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+	}
+
+	return nil
 }
 
 // downloadCertsFromSecret writes to the filesystem the content of each field in the secret
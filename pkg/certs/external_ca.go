@@ -0,0 +1,511 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+// ExternalCAMode selects how EnsureCerts obtains the CA(s) it signs vcluster's certs with.
+type ExternalCAMode string
+
+const (
+	// ExternalCAModeFromSecret pre-seeds certificateDir with a user-supplied ca.crt/ca.key
+	// before CreatePKIAssets runs, so kubeadm signs every leaf with the provided CA.
+	ExternalCAModeFromSecret ExternalCAMode = "FromSecret"
+	// ExternalCAModeCAOnly is like FromSecret, but ca.key is absent: every leaf and kubeconfig
+	// derived from this CA is requested from the cert-manager Issuer/ClusterIssuer named by
+	// IssuerRef instead, so IssuerRef is required in this mode. This CA's key is never read or
+	// required to be present on disk, unlike FromSecret.
+	ExternalCAModeCAOnly ExternalCAMode = "CAOnly"
+	// ExternalCAModeCertManagerIssuer requests every required leaf from a cert-manager
+	// Issuer/ClusterIssuer instead of minting/using a local CA at all.
+	ExternalCAModeCertManagerIssuer ExternalCAMode = "CertManagerIssuer"
+)
+
+// ExternalCA configures where a single CA (apiserver, front-proxy or etcd) comes from.
+type ExternalCA struct {
+	Mode ExternalCAMode
+
+	// SecretRef is used by FromSecret and CAOnly: a Secret containing ca.crt (+ ca.key for
+	// FromSecret).
+	SecretRef *corev1.SecretReference
+
+	// IssuerRef is used by CertManagerIssuer and CAOnly.
+	IssuerRef CertManagerIssuerRef
+}
+
+// CertManagerIssuerRef identifies the cert-manager Issuer/ClusterIssuer to request certs from.
+type CertManagerIssuerRef struct {
+	Name string
+	Kind string // "Issuer" or "ClusterIssuer"
+	// Group defaults to cert-manager.io.
+	Group string
+}
+
+// ExternalCAs lets the apiserver, front-proxy and etcd CAs be configured independently, since
+// real-world deployments often only control the API server root.
+type ExternalCAs struct {
+	APIServer  *ExternalCA
+	FrontProxy *ExternalCA
+	Etcd       *ExternalCA
+}
+
+// CertsOptions extends EnsureCerts with optional private-material storage (opts.Store) and
+// bring-your-own-CA configuration (opts.ExternalCAs).
+type CertsOptions struct {
+	Store StoreConfig
+
+	// ExternalCAs lets the apiserver/front-proxy/etcd CAs chain to a CA the caller already
+	// controls instead of always minting a fresh self-signed one. Leave nil to keep the
+	// default behavior.
+	ExternalCAs *ExternalCAs
+
+	// CertManagerClient is required when any ExternalCAs entry uses
+	// ExternalCAModeCertManagerIssuer.
+	CertManagerClient cmclient.Interface
+}
+
+// certManagerWaitTimeout bounds how long EnsureCertsWithOptions waits for cert-manager to issue
+// each requested Certificate.
+const certManagerWaitTimeout = 2 * time.Minute
+
+// apiServerSANs derives the DNS names and IPs the apiserver leaf needs from cfg, mirroring what
+// CreatePKIAssets would otherwise compute internally.
+func apiServerSANs(cfg *InitConfiguration) ([]string, []string) {
+	dnsNames := []string{
+		"kubernetes",
+		"kubernetes.default",
+		"kubernetes.default.svc",
+		fmt.Sprintf("kubernetes.default.svc.%s", cfg.Networking.DNSDomain),
+		cfg.NodeRegistration.Name,
+	}
+
+	ips := []string{"127.0.0.1", cfg.LocalAPIEndpoint.AdvertiseAddress}
+	if _, cidr, err := net.ParseCIDR(cfg.Networking.ServiceSubnet); err == nil {
+		ips = append(ips, firstServiceIP(cidr).String())
+	}
+
+	return dnsNames, ips
+}
+
+// firstServiceIP returns the first usable address in cidr, which is what kubeadm assigns to the
+// "kubernetes" Service in the cluster's service subnet.
+func firstServiceIP(cidr *net.IPNet) net.IP {
+	ip := make(net.IP, len(cidr.IP))
+	copy(ip, cidr.IP)
+	ip[len(ip)-1]++
+	return ip
+}
+
+// externalCAFor returns the ExternalCA governing the given caSlot name ("apiserver",
+// "front-proxy" or "etcd"), or nil if cas is nil or that slot isn't externally managed.
+func externalCAFor(slot string, cas *ExternalCAs) *ExternalCA {
+	if cas == nil {
+		return nil
+	}
+
+	switch slot {
+	case "apiserver":
+		return cas.APIServer
+	case "front-proxy":
+		return cas.FrontProxy
+	case "etcd":
+		return cas.Etcd
+	default:
+		return nil
+	}
+}
+
+// seedExternalCAs pre-seeds certificateDir with any FromSecret/CAOnly CAs in cas before
+// CreatePKIAssets runs, validating that each supplied CA can actually sign leaves.
+func seedExternalCAs(
+	ctx context.Context,
+	client kubernetes.Interface,
+	namespace string,
+	certificateDir string,
+	cas *ExternalCAs,
+) error {
+	if cas == nil {
+		return nil
+	}
+
+	for _, ca := range []struct {
+		ca                *ExternalCA
+		certFile, keyFile string
+	}{
+		{cas.APIServer, "ca.crt", "ca.key"},
+		{cas.FrontProxy, "front-proxy-ca.crt", "front-proxy-ca.key"},
+		{cas.Etcd, filepath.Join("etcd", "ca.crt"), filepath.Join("etcd", "ca.key")},
+	} {
+		if err := seedExternalCA(ctx, client, namespace, certificateDir, ca.ca, ca.certFile, ca.keyFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedExternalCA writes the CA referenced by ca into certificateDir under certFile (+ keyFile for
+// FromSecret). CertManagerIssuer mode is a no-op here: it has no ca.crt to seed ahead of time, so
+// its CA file is instead backfilled by seedCASlotFromResponse from the first leaf cert-manager
+// issues, since cert-manager populates ca.crt on the leaf's Secret when the issuer exposes its
+// chain.
+func seedExternalCA(
+	ctx context.Context,
+	client kubernetes.Interface,
+	namespace string,
+	certificateDir string,
+	ca *ExternalCA,
+	certFile, keyFile string,
+) error {
+	if ca == nil {
+		return nil
+	}
+
+	switch ca.Mode {
+	case ExternalCAModeFromSecret, ExternalCAModeCAOnly:
+		if ca.SecretRef == nil {
+			return fmt.Errorf("external ca mode %s requires a secretRef", ca.Mode)
+		}
+		if ca.Mode == ExternalCAModeCAOnly && ca.IssuerRef.Name == "" {
+			return fmt.Errorf("external ca mode %s requires an issuerRef so every leaf derived from it can be requested from cert-manager instead of being signed locally", ca.Mode)
+		}
+
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, ca.SecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get external ca secret %s: %w", ca.SecretRef.Name, err)
+		}
+
+		caCert, ok := secret.Data["ca.crt"]
+		if !ok {
+			return fmt.Errorf("secret %s is missing ca.crt", ca.SecretRef.Name)
+		}
+		if err := validateCACert(caCert); err != nil {
+			return fmt.Errorf("external ca in secret %s: %w", ca.SecretRef.Name, err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(certificateDir, certFile)), 0755); err != nil {
+			return fmt.Errorf("create directory for %s: %w", certFile, err)
+		}
+		if err := os.WriteFile(filepath.Join(certificateDir, certFile), caCert, 0644); err != nil {
+			return fmt.Errorf("write %s: %w", certFile, err)
+		}
+
+		caKey, hasKey := secret.Data["ca.key"]
+		if ca.Mode == ExternalCAModeFromSecret {
+			if !hasKey {
+				return fmt.Errorf("secret %s is missing ca.key, required for FromSecret mode", ca.SecretRef.Name)
+			}
+			if err := os.WriteFile(filepath.Join(certificateDir, keyFile), caKey, 0600); err != nil {
+				return fmt.Errorf("write %s: %w", keyFile, err)
+			}
+		}
+
+		return nil
+	case ExternalCAModeCertManagerIssuer:
+		return nil
+	default:
+		return fmt.Errorf("unknown external ca mode %q", ca.Mode)
+	}
+}
+
+// validateCACert checks that the supplied certificate can actually sign the leaves vcluster
+// needs: it must be marked as a CA per its basic constraints and carry the cert-signing usage.
+func validateCACert(pemBytes []byte) error {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return fmt.Errorf("ca.crt is not valid PEM")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse ca.crt: %w", err)
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("certificate is not a CA per its basic constraints")
+	}
+	if cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("certificate key usage does not include certSign")
+	}
+
+	return nil
+}
+
+// certManagerLeafRequest describes one artifact derived from a CA slot that can be requested from
+// a cert-manager Issuer instead of being minted by CreatePKIAssets: either a raw leaf cert/key
+// pair (fromName) or a kubeconfig built from the issued cert/key pair (kubeconfigName).
+type certManagerLeafRequest struct {
+	// fromName is the certMap key (on-disk filename) a raw issued cert/key pair should be
+	// written as. Mutually exclusive with kubeconfigName.
+	fromName string
+	// kubeconfigName is the on-disk kubeconfig filename (e.g. "admin.conf") to build from the
+	// issued cert/key pair plus the CA slot's ca.crt. Mutually exclusive with fromName.
+	kubeconfigName string
+
+	cn            string
+	organizations []string
+	usages        []cmapi.KeyUsage
+
+	// caSlot is the caSlots entry (and therefore the ExternalCAs field, via externalCAFor) that
+	// governs this artifact.
+	caSlot string
+}
+
+// certManagerLeafRequests enumerates every artifact derived from the apiserver, front-proxy and
+// etcd CAs: the raw leaf certs kubeadm would otherwise mint, plus the three client kubeconfigs
+// that embed an apiserver-CA-signed client cert. A CAOnly/CertManagerIssuer CA slot must have
+// every one of these requested from cert-manager -- leaving even one on the throwaway local CA
+// CreatePKIAssets mints in its place would make it fail to authenticate against the
+// cert-manager-issued server certs.
+var certManagerLeafRequests = []certManagerLeafRequest{
+	{fromName: "apiserver.crt", cn: "kube-apiserver", usages: []cmapi.KeyUsage{cmapi.UsageServerAuth}, caSlot: "apiserver"},
+	{fromName: "apiserver-kubelet-client.crt", cn: "kube-apiserver-kubelet-client", usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "apiserver"},
+	{kubeconfigName: "admin.conf", cn: "kubernetes-admin", organizations: []string{"system:masters"}, usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "apiserver"},
+	{kubeconfigName: "controller-manager.conf", cn: "system:kube-controller-manager", usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "apiserver"},
+	{kubeconfigName: "scheduler.conf", cn: "system:kube-scheduler", usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "apiserver"},
+	{fromName: "front-proxy-client.crt", cn: "front-proxy-client", usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "front-proxy"},
+	{fromName: filepath.Join("etcd", "server.crt"), cn: "etcd-server", usages: []cmapi.KeyUsage{cmapi.UsageServerAuth, cmapi.UsageClientAuth}, caSlot: "etcd"},
+	{fromName: filepath.Join("etcd", "peer.crt"), cn: "etcd-peer", usages: []cmapi.KeyUsage{cmapi.UsageServerAuth, cmapi.UsageClientAuth}, caSlot: "etcd"},
+	{fromName: filepath.Join("etcd", "healthcheck-client.crt"), cn: "kube-etcd-healthcheck-client", usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "etcd"},
+	{fromName: "apiserver-etcd-client.crt", cn: "kube-apiserver-etcd-client", usages: []cmapi.KeyUsage{cmapi.UsageClientAuth}, caSlot: "etcd"},
+}
+
+// requiresCertManagerLeaves reports whether every artifact derived from ca must be requested from
+// cert-manager rather than left to CreatePKIAssets: true for CAOnly (no local key to sign with)
+// and CertManagerIssuer (no local CA at all).
+func requiresCertManagerLeaves(ca *ExternalCA) bool {
+	return ca != nil && (ca.Mode == ExternalCAModeCertManagerIssuer || ca.Mode == ExternalCAModeCAOnly)
+}
+
+// caCertFileFor returns the caSlots certFile for the given slot name, or "" if unknown.
+func caCertFileFor(slot string) string {
+	for _, s := range caSlots {
+		if s.name == slot {
+			return s.certFile
+		}
+	}
+	return ""
+}
+
+// seedCASlotFromResponse writes caCert into certificateDir under slot's cert file if it isn't
+// already there. CertManagerIssuer mode has no SecretRef to seed ca.crt from ahead of time, so the
+// first successfully issued leaf's ca.crt response (populated by cert-manager when the issuer
+// exposes its chain) seeds it instead.
+func seedCASlotFromResponse(certificateDir, slot string, caCert []byte) error {
+	if len(caCert) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(certificateDir, caCertFileFor(slot))
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory for %s ca: %w", slot, err)
+	}
+	return os.WriteFile(path, caCert, 0644)
+}
+
+// writeClientKubeconfig builds a kubeconfig embedding clientCert/clientKey and caCert and writes
+// it to certificateDir/fileName, the way CreateJoinControlPlaneKubeConfigFiles would for a
+// locally-signed CA.
+func writeClientKubeconfig(certificateDir, fileName, clusterName, server string, caCert, clientCert, clientKey []byte) error {
+	cfg := clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			clusterName: {Server: server, CertificateAuthorityData: caCert},
+		},
+		Contexts: map[string]*clientcmdapi.Context{
+			clusterName: {Cluster: clusterName, AuthInfo: clusterName},
+		},
+		CurrentContext: clusterName,
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			clusterName: {ClientCertificateData: clientCert, ClientKeyData: clientKey},
+		},
+	}
+
+	return clientcmd.WriteToFile(cfg, filepath.Join(certificateDir, fileName))
+}
+
+// requestCertManagerCerts creates a cert-manager Certificate CR for every artifact governed by a
+// CAOnly/CertManagerIssuer CA in cas, waits for the resulting Secret, and writes the result into
+// certificateDir -- a raw cert/key pair for a leaf, or a built kubeconfig -- so downloadCerts/the
+// secret-building loop in EnsureCerts can pick it up like any other file CreatePKIAssets would
+// have produced.
+func requestCertManagerCerts(
+	ctx context.Context,
+	cmClient cmclient.Interface,
+	k8sClient kubernetes.Interface,
+	namespace string,
+	vClusterName string,
+	certificateDir string,
+	dnsNames, ipAddrs []string,
+	etcdSans []string,
+	cas *ExternalCAs,
+	controlPlaneEndpoint string,
+) error {
+	if cas == nil {
+		return nil
+	}
+
+	for _, req := range certManagerLeafRequests {
+		ca := externalCAFor(req.caSlot, cas)
+		if !requiresCertManagerLeaves(ca) {
+			continue
+		}
+
+		sans := dnsNames
+		if req.caSlot == "etcd" {
+			sans = etcdSans
+		}
+
+		if err := requestCertManagerCert(ctx, cmClient, k8sClient, namespace, vClusterName, certificateDir, req, sans, ipAddrs, ca.IssuerRef, controlPlaneEndpoint); err != nil {
+			return fmt.Errorf("request %s from cert-manager: %w", req.cn, err)
+		}
+	}
+
+	return nil
+}
+
+func requestCertManagerCert(
+	ctx context.Context,
+	cmClient cmclient.Interface,
+	k8sClient kubernetes.Interface,
+	namespace string,
+	vClusterName string,
+	certificateDir string,
+	req certManagerLeafRequest,
+	dnsNames, ipAddrs []string,
+	issuerRef CertManagerIssuerRef,
+	controlPlaneEndpoint string,
+) error {
+	group := issuerRef.Group
+	if group == "" {
+		group = "cert-manager.io"
+	}
+
+	leafName := req.fromName
+	if req.kubeconfigName != "" {
+		leafName = req.kubeconfigName
+	}
+	certName := fmt.Sprintf("%s-%s", vClusterName, strings.ReplaceAll(filepath.Base(leafName[:len(leafName)-len(filepath.Ext(leafName))]), "_", "-"))
+	secretName := certName + "-tls"
+
+	spec := cmapi.CertificateSpec{
+		SecretName: secretName,
+		CommonName: req.cn,
+		Usages:     req.usages,
+		IssuerRef: cmmeta.ObjectReference{
+			Name:  issuerRef.Name,
+			Kind:  issuerRef.Kind,
+			Group: group,
+		},
+	}
+	if req.kubeconfigName == "" {
+		spec.DNSNames = dnsNames
+		spec.IPAddresses = ipAddrs
+	}
+	if len(req.organizations) > 0 {
+		spec.Subject = &cmapi.X509Subject{Organizations: req.organizations}
+	}
+
+	cert := &cmapi.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      certName,
+			Namespace: namespace,
+		},
+		Spec: spec,
+	}
+
+	_, err := cmClient.CertmanagerV1().Certificates(namespace).Create(ctx, cert, metav1.CreateOptions{})
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create certificate %s: %w", certName, err)
+	}
+
+	var secret *corev1.Secret
+	waitErr := wait.PollUntilContextTimeout(ctx, time.Second, certManagerWaitTimeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		secret, err = k8sClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return len(secret.Data["tls.crt"]) > 0 && len(secret.Data["tls.key"]) > 0, nil
+	})
+	if waitErr != nil {
+		return fmt.Errorf("wait for certificate %s to be issued: %w", certName, waitErr)
+	}
+
+	klog.Infof("issued %s from cert-manager certificate %s/%s", req.cn, namespace, certName)
+
+	if err := seedCASlotFromResponse(certificateDir, req.caSlot, secret.Data["ca.crt"]); err != nil {
+		return fmt.Errorf("seed %s ca from cert-manager response: %w", req.caSlot, err)
+	}
+
+	if req.kubeconfigName != "" {
+		caCert, err := os.ReadFile(filepath.Join(certificateDir, caCertFileFor(req.caSlot)))
+		if err != nil {
+			return fmt.Errorf("read %s ca for kubeconfig %s: %w", req.caSlot, req.kubeconfigName, err)
+		}
+		if err := writeClientKubeconfig(certificateDir, req.kubeconfigName, "kubernetes", controlPlaneEndpoint, caCert, secret.Data["tls.crt"], secret.Data["tls.key"]); err != nil {
+			return fmt.Errorf("write %s: %w", req.kubeconfigName, err)
+		}
+		return nil
+	}
+
+	path := filepath.Join(certificateDir, req.fromName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory for %s: %w", req.fromName, err)
+	}
+	if err := os.WriteFile(path, secret.Data["tls.crt"], 0644); err != nil {
+		return fmt.Errorf("write %s: %w", req.fromName, err)
+	}
+
+	keyFile := req.fromName[:len(req.fromName)-len(filepath.Ext(req.fromName))] + ".key"
+	if err := os.WriteFile(filepath.Join(certificateDir, keyFile), secret.Data["tls.key"], 0600); err != nil {
+		return fmt.Errorf("write %s: %w", keyFile, err)
+	}
+
+	return nil
+}
+
+// createPKIAssets mints CA and leaf material for every caSlot not governed by a CAOnly/
+// CertManagerIssuer CA, via CreatePKIAssetsForCA per slot instead of the monolithic
+// CreatePKIAssets -- which would otherwise try to sign that slot's leaves with a key it was never
+// given (CAOnly has no ca.key by design) or silently mint a throwaway local CA in its place
+// (CertManagerIssuer). Every artifact derived from a skipped slot is instead requested from
+// cert-manager by requestCertManagerCerts.
+func createPKIAssets(cfg *InitConfiguration, cas *ExternalCAs) error {
+	if cas == nil {
+		return CreatePKIAssets(cfg)
+	}
+
+	for _, slot := range caSlots {
+		if requiresCertManagerLeaves(externalCAFor(slot.name, cas)) {
+			continue
+		}
+		if err := CreatePKIAssetsForCA(cfg, slot.name); err != nil {
+			return fmt.Errorf("create %s pki assets: %w", slot.name, err)
+		}
+	}
+
+	return CreateServiceAccountKeyAndPublicKeyFiles(cfg)
+}
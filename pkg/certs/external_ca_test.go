@@ -0,0 +1,319 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func selfSignedCertPEM(t *testing.T, template *x509.Certificate) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestValidateCACert(t *testing.T) {
+	now := time.Now()
+
+	t.Run("valid ca cert", func(t *testing.T) {
+		pemBytes := selfSignedCertPEM(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "test-ca"},
+			NotBefore:             now,
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		})
+
+		if err := validateCACert(pemBytes); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("not a ca", func(t *testing.T) {
+		pemBytes := selfSignedCertPEM(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(2),
+			Subject:               pkix.Name{CommonName: "leaf"},
+			NotBefore:             now,
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  false,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		})
+
+		if err := validateCACert(pemBytes); err == nil {
+			t.Fatalf("expected an error for a non-CA certificate")
+		}
+	})
+
+	t.Run("missing certSign usage", func(t *testing.T) {
+		pemBytes := selfSignedCertPEM(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(3),
+			Subject:               pkix.Name{CommonName: "test-ca"},
+			NotBefore:             now,
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+		})
+
+		if err := validateCACert(pemBytes); err == nil {
+			t.Fatalf("expected an error when certSign usage is missing")
+		}
+	})
+
+	t.Run("not valid pem", func(t *testing.T) {
+		if err := validateCACert([]byte("not a pem block")); err == nil {
+			t.Fatalf("expected an error for invalid PEM")
+		}
+	})
+}
+
+func selfSignedCACertPEM(t *testing.T, cn string) []byte {
+	t.Helper()
+	return selfSignedCertPEM(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+}
+
+func TestSeedExternalCAFromSecret(t *testing.T) {
+	dir := t.TempDir()
+	caCert := selfSignedCACertPEM(t, "external-ca")
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-ca", Namespace: "ns"},
+		Data:       map[string][]byte{"ca.crt": caCert, "ca.key": []byte("fake-key")},
+	})
+
+	ca := &ExternalCA{Mode: ExternalCAModeFromSecret, SecretRef: &corev1.SecretReference{Name: "external-ca"}}
+	if err := seedExternalCA(context.Background(), client, "ns", dir, ca, "ca.crt", "ca.key"); err != nil {
+		t.Fatalf("seedExternalCA: %v", err)
+	}
+
+	gotCert, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("read ca.crt: %v", err)
+	}
+	if string(gotCert) != string(caCert) {
+		t.Errorf("unexpected ca.crt content")
+	}
+
+	gotKey, err := os.ReadFile(filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("read ca.key: %v", err)
+	}
+	if string(gotKey) != "fake-key" {
+		t.Errorf("unexpected ca.key content")
+	}
+}
+
+func TestSeedExternalCACAOnlyRequiresIssuerRef(t *testing.T) {
+	dir := t.TempDir()
+	caCert := selfSignedCACertPEM(t, "external-ca")
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-ca", Namespace: "ns"},
+		Data:       map[string][]byte{"ca.crt": caCert},
+	})
+
+	ca := &ExternalCA{Mode: ExternalCAModeCAOnly, SecretRef: &corev1.SecretReference{Name: "external-ca"}}
+	if err := seedExternalCA(context.Background(), client, "ns", dir, ca, "ca.crt", "ca.key"); err == nil {
+		t.Fatalf("expected an error when CAOnly has no IssuerRef")
+	}
+}
+
+func TestSeedExternalCACAOnlyWithIssuerRefSkipsKey(t *testing.T) {
+	dir := t.TempDir()
+	caCert := selfSignedCACertPEM(t, "external-ca")
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-ca", Namespace: "ns"},
+		Data:       map[string][]byte{"ca.crt": caCert},
+	})
+
+	ca := &ExternalCA{
+		Mode:      ExternalCAModeCAOnly,
+		SecretRef: &corev1.SecretReference{Name: "external-ca"},
+		IssuerRef: CertManagerIssuerRef{Name: "my-issuer", Kind: "ClusterIssuer"},
+	}
+	if err := seedExternalCA(context.Background(), client, "ns", dir, ca, "ca.crt", "ca.key"); err != nil {
+		t.Fatalf("seedExternalCA: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "ca.key")); !os.IsNotExist(err) {
+		t.Errorf("expected no ca.key to be written for CAOnly mode")
+	}
+}
+
+func TestSeedExternalCAValidatesCert(t *testing.T) {
+	dir := t.TempDir()
+	leafCert := selfSignedCertPEM(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "not-a-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  false,
+		BasicConstraintsValid: true,
+	})
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-ca", Namespace: "ns"},
+		Data:       map[string][]byte{"ca.crt": leafCert, "ca.key": []byte("fake-key")},
+	})
+
+	ca := &ExternalCA{Mode: ExternalCAModeFromSecret, SecretRef: &corev1.SecretReference{Name: "external-ca"}}
+	if err := seedExternalCA(context.Background(), client, "ns", dir, ca, "ca.crt", "ca.key"); err == nil {
+		t.Fatalf("expected an error when the supplied cert isn't a CA")
+	}
+}
+
+func TestRequestCertManagerCertWritesRawLeaf(t *testing.T) {
+	dir := t.TempDir()
+	leafCert := []byte("leaf-cert-pem")
+	leafKey := []byte("leaf-key-pem")
+
+	req := certManagerLeafRequest{
+		fromName: "front-proxy-client.crt",
+		cn:       "front-proxy-client",
+		usages:   []cmapi.KeyUsage{cmapi.UsageClientAuth},
+		caSlot:   "front-proxy",
+	}
+
+	secretName := "my-vcluster-front-proxy-client-tls"
+	k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: "ns"},
+		Data:       map[string][]byte{"tls.crt": leafCert, "tls.key": leafKey},
+	})
+	cmClient := cmfake.NewSimpleClientset()
+
+	issuerRef := CertManagerIssuerRef{Name: "my-issuer", Kind: "ClusterIssuer"}
+	err := requestCertManagerCert(context.Background(), cmClient, k8sClient, "ns", "my-vcluster", dir, req, nil, nil, issuerRef, "127.0.0.1:6443")
+	if err != nil {
+		t.Fatalf("requestCertManagerCert: %v", err)
+	}
+
+	gotCert, err := os.ReadFile(filepath.Join(dir, "front-proxy-client.crt"))
+	if err != nil {
+		t.Fatalf("read leaf cert: %v", err)
+	}
+	if string(gotCert) != string(leafCert) {
+		t.Errorf("unexpected leaf cert content")
+	}
+
+	gotKey, err := os.ReadFile(filepath.Join(dir, "front-proxy-client.key"))
+	if err != nil {
+		t.Fatalf("read leaf key: %v", err)
+	}
+	if string(gotKey) != string(leafKey) {
+		t.Errorf("unexpected leaf key content")
+	}
+
+	certs, err := cmClient.CertmanagerV1().Certificates("ns").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list certificates: %v", err)
+	}
+	if len(certs.Items) != 1 {
+		t.Fatalf("expected 1 Certificate to be created, got %d", len(certs.Items))
+	}
+}
+
+func TestRequestCertManagerCertBuildsKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	caCert := selfSignedCACertPEM(t, "apiserver-ca")
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), caCert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert := []byte("admin-cert-pem")
+	clientKey := []byte("admin-key-pem")
+
+	req := certManagerLeafRequest{
+		kubeconfigName: "admin.conf",
+		cn:             "kubernetes-admin",
+		organizations:  []string{"system:masters"},
+		usages:         []cmapi.KeyUsage{cmapi.UsageClientAuth},
+		caSlot:         "apiserver",
+	}
+
+	secretName := "my-vcluster-admin-tls"
+	k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: "ns"},
+		Data:       map[string][]byte{"tls.crt": clientCert, "tls.key": clientKey},
+	})
+	cmClient := cmfake.NewSimpleClientset()
+
+	issuerRef := CertManagerIssuerRef{Name: "my-issuer", Kind: "ClusterIssuer"}
+	err := requestCertManagerCert(context.Background(), cmClient, k8sClient, "ns", "my-vcluster", dir, req, nil, nil, issuerRef, "127.0.0.1:6443")
+	if err != nil {
+		t.Fatalf("requestCertManagerCert: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "admin.conf")); err != nil {
+		t.Fatalf("expected admin.conf to be written: %v", err)
+	}
+}
+
+func TestRequestCertManagerCertSeedsCAFromResponse(t *testing.T) {
+	dir := t.TempDir()
+	caCert := selfSignedCACertPEM(t, "etcd-ca")
+
+	req := certManagerLeafRequest{
+		fromName: filepath.Join("etcd", "server.crt"),
+		cn:       "etcd-server",
+		usages:   []cmapi.KeyUsage{cmapi.UsageServerAuth, cmapi.UsageClientAuth},
+		caSlot:   "etcd",
+	}
+
+	secretName := "my-vcluster-server-tls"
+	k8sClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: "ns"},
+		Data:       map[string][]byte{"tls.crt": []byte("leaf"), "tls.key": []byte("key"), "ca.crt": caCert},
+	})
+	cmClient := cmfake.NewSimpleClientset()
+
+	issuerRef := CertManagerIssuerRef{Name: "my-issuer", Kind: "ClusterIssuer"}
+	err := requestCertManagerCert(context.Background(), cmClient, k8sClient, "ns", "my-vcluster", dir, req, nil, nil, issuerRef, "127.0.0.1:6443")
+	if err != nil {
+		t.Fatalf("requestCertManagerCert: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "etcd", "ca.crt"))
+	if err != nil {
+		t.Fatalf("expected etcd ca.crt to be backfilled from the response: %v", err)
+	}
+	if string(got) != string(caCert) {
+		t.Errorf("unexpected backfilled ca.crt content")
+	}
+}
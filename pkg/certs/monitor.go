@@ -0,0 +1,224 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+var certExpirySeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "vcluster_cert_expiry_seconds",
+	Help: "Seconds remaining until the certificate's NotAfter is reached, labelled by cert file.",
+}, []string{"cert"})
+
+const (
+	// leafRenewalFraction mirrors kubelet's dynamic certificate manager: a leaf cert is renewed
+	// once roughly a third of its own validity period remains, rather than a flat number of days,
+	// so a 90-day cert and a 1-year cert are each renewed proportionally to their own lifetime.
+	leafRenewalFraction = 1.0 / 3.0
+
+	// defaultCAWarningThreshold is how close to expiry a CA must be before CertMonitor emits a
+	// CACloseToExpiry event. CAs are never auto-rotated (that needs an explicit RotateCA and a
+	// trust-overlap window), so there's no proportional renewal threshold for them, just a flat
+	// warning window.
+	defaultCAWarningThreshold = 30 * 24 * time.Hour
+	defaultCheckInterval      = time.Hour
+
+	reasonCertRenewed       = "CertRenewed"
+	reasonCertRenewalFailed = "CertRenewalFailed"
+	reasonCACloseToExpiry   = "CACloseToExpiry"
+)
+
+// CertMonitor periodically parses every PEM under certificateDir, exposes
+// vcluster_cert_expiry_seconds gauges, and automatically rotates leaf certs that are close to
+// expiring. CAs are never auto-rotated since that needs a trust-overlap window; instead a
+// CACloseToExpiry event is emitted so an operator can run RotateCA explicitly.
+type CertMonitor struct {
+	client         kubernetes.Interface
+	namespace      string
+	vClusterName   string
+	certificateDir string
+
+	caWarningThreshold time.Duration
+	checkInterval      time.Duration
+
+	// certsOpts is threaded into every auto-renewal RotateCerts call so a configured CertStore
+	// or bring-your-own-CA/cert-manager setup is honored the same way as an explicit operator-
+	// triggered rotation. Set it with WithCertsOptions.
+	certsOpts CertsOptions
+
+	eventObject *corev1.ObjectReference
+	recorder    record.EventRecorder
+}
+
+// NewCertMonitor builds a CertMonitor that emits events against the vcluster's Service.
+func NewCertMonitor(ctx context.Context, client kubernetes.Interface, namespace, vClusterName, certificateDir string) (*CertMonitor, error) {
+	svc, err := client.CoreV1().Services(namespace).Get(ctx, vClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get vcluster service %s/%s: %w", namespace, vClusterName, err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events(namespace)})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "vcluster-certs"})
+
+	return &CertMonitor{
+		client:             client,
+		namespace:          namespace,
+		vClusterName:       vClusterName,
+		certificateDir:     certificateDir,
+		caWarningThreshold: defaultCAWarningThreshold,
+		checkInterval:      defaultCheckInterval,
+		eventObject: &corev1.ObjectReference{
+			Kind:      "Service",
+			Namespace: svc.Namespace,
+			Name:      svc.Name,
+			UID:       svc.UID,
+		},
+		recorder: recorder,
+	}, nil
+}
+
+// WithRenewalThreshold overrides the default 30-day CA-close-to-expiry warning threshold. Leaf
+// certs are always renewed proportionally (see leafRenewalFraction), not against this value.
+func (m *CertMonitor) WithRenewalThreshold(d time.Duration) *CertMonitor {
+	m.caWarningThreshold = d
+	return m
+}
+
+// WithCheckInterval overrides how often CertMonitor checks expiry. Defaults to 1h.
+func (m *CertMonitor) WithCheckInterval(d time.Duration) *CertMonitor {
+	m.checkInterval = d
+	return m
+}
+
+// WithCertsOptions sets the store/external-CA configuration auto-renewal rotations are run with.
+// Pass the same CertsOptions the vcluster was set up with, so auto-renewal doesn't write private
+// material into a plain Secret or replace a bring-your-own/cert-manager CA with a local one.
+func (m *CertMonitor) WithCertsOptions(opts CertsOptions) *CertMonitor {
+	m.certsOpts = opts
+	return m
+}
+
+// Start runs the monitor loop until ctx is done. Run it in its own goroutine.
+func (m *CertMonitor) Start(ctx context.Context) {
+	wait.Until(func() { m.checkOnce(ctx) }, m.checkInterval, ctx.Done())
+}
+
+func (m *CertMonitor) checkOnce(ctx context.Context) {
+	if err := PruneCATrustOverlap(ctx, m.namespace, m.client, m.vClusterName, m.certificateDir); err != nil {
+		klog.Errorf("prune ca trust overlap for vcluster %s/%s: %v", m.namespace, m.vClusterName, err)
+	}
+
+	validities, err := m.readExpirations()
+	if err != nil {
+		klog.Errorf("read cert expirations for vcluster %s/%s: %v", m.namespace, m.vClusterName, err)
+		return
+	}
+
+	now := time.Now()
+	renewLeaves := false
+	for name, v := range validities {
+		remaining := v.notAfter.Sub(now)
+		certExpirySeconds.WithLabelValues(name).Set(remaining.Seconds())
+
+		if isCAFile(name) {
+			if remaining < m.caWarningThreshold {
+				m.recorder.Eventf(m.eventObject, corev1.EventTypeWarning, reasonCACloseToExpiry,
+					"CA %s expires in %s and cannot be auto-rotated without a trust-overlap window, run RotateCA", name, remaining.Round(time.Hour))
+			}
+			continue
+		}
+
+		if remaining < v.renewalThreshold() {
+			renewLeaves = true
+		}
+	}
+
+	if !renewLeaves {
+		return
+	}
+
+	if err := RotateCerts(ctx, m.namespace, m.client, m.vClusterName, m.certificateDir, RotateOptions{Force: true, Certs: m.certsOpts}); err != nil {
+		m.recorder.Eventf(m.eventObject, corev1.EventTypeWarning, reasonCertRenewalFailed, "failed to auto-renew leaf certs: %v", err)
+		klog.Errorf("auto-renew certs for vcluster %s/%s: %v", m.namespace, m.vClusterName, err)
+		return
+	}
+
+	m.recorder.Event(m.eventObject, corev1.EventTypeNormal, reasonCertRenewed, "auto-renewed leaf certificates nearing expiry")
+}
+
+// certValidity is a cert's validity window, used to compute its proportional renewal threshold.
+type certValidity struct {
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// renewalThreshold is how close to notAfter this cert must get before it's renewed: roughly a
+// third of its own total validity period, mirroring kubelet's dynamic certificate manager.
+func (v certValidity) renewalThreshold() time.Duration {
+	return time.Duration(float64(v.notAfter.Sub(v.notBefore)) * leafRenewalFraction)
+}
+
+// readExpirations parses every *.crt file under certificateDir and returns its validity window,
+// keyed by the path relative to certificateDir (matching the keys caFiles uses).
+func (m *CertMonitor) readExpirations() (map[string]certValidity, error) {
+	validities := map[string]certValidity{}
+
+	err := filepath.WalkDir(m.certificateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".crt") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(m.certificateDir, path)
+		if err != nil {
+			rel = path
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil {
+			klog.V(4).Infof("skip %s: not valid PEM", rel)
+			return nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			klog.V(4).Infof("skip %s: %v", rel, err)
+			return nil
+		}
+
+		validities[rel] = certValidity{notBefore: cert.NotBefore, notAfter: cert.NotAfter}
+		return nil
+	})
+
+	return validities, err
+}
+
+func isCAFile(relPath string) bool {
+	return slices.Contains(caFiles, relPath)
+}
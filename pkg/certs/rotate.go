@@ -0,0 +1,466 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// annotationServiceCIDR, annotationClusterDomain and annotationEtcdSans record the inputs
+	// EnsureCerts issued the certs with, so RotateCerts can rebuild the kubeadm
+	// InitConfiguration later without the caller having to re-supply them.
+	annotationServiceCIDR   = "certs.vcluster.loft.sh/service-cidr"
+	annotationClusterDomain = "certs.vcluster.loft.sh/cluster-domain"
+	annotationEtcdSans      = "certs.vcluster.loft.sh/etcd-sans"
+
+	// annotationCATrustOverlapUntil records when the previous CA stops being trusted after a
+	// full CA rotation. PruneCATrustOverlap drops it from the ca.crt bundle once this time has
+	// passed.
+	annotationCATrustOverlapUntil = "certs.vcluster.loft.sh/ca-trust-overlap-until"
+
+	// defaultCATrustOverlap is how long the previous CA is kept in the ca.crt bundle after a
+	// full rotation, so clients that cached the old trust bundle keep working until they refresh.
+	defaultCATrustOverlap = 24 * time.Hour
+)
+
+// caSlot groups the cert/key pair for one of the CAs vcluster mints: the apiserver/cluster CA,
+// the front-proxy CA and the etcd CA.
+type caSlot struct {
+	name              string
+	certFile, keyFile string
+}
+
+var caSlots = []caSlot{
+	{name: "apiserver", certFile: "ca.crt", keyFile: "ca.key"},
+	{name: "front-proxy", certFile: "front-proxy-ca.crt", keyFile: "front-proxy-ca.key"},
+	{name: "etcd", certFile: filepath.Join("etcd", "ca.crt"), keyFile: filepath.Join("etcd", "ca.key")},
+}
+
+// caFiles lists every CA cert/key file caSlots covers. Kept around because monitor.go's
+// isCAFile matches against it.
+var caFiles = func() []string {
+	files := make([]string, 0, len(caSlots)*2)
+	for _, slot := range caSlots {
+		files = append(files, slot.certFile, slot.keyFile)
+	}
+	return files
+}()
+
+// RotateOptions controls how RotateCerts rebuilds the PKI for an existing vcluster.
+type RotateOptions struct {
+	// ServiceCIDR, ClusterDomain and EtcdSans override the values the certs were originally
+	// issued with. Leave empty/nil to keep the existing value. If any of them differ from what
+	// is stored on the secret, the leaf certs are re-issued even when RotateCA is false.
+	ServiceCIDR   string
+	ClusterDomain string
+	EtcdSans      []string
+
+	// RotateCA forces a full CA rollover instead of the SANs-changed leaf-only fast path.
+	RotateCA bool
+
+	// Force re-issues the leaves even if none of ServiceCIDR, ClusterDomain or EtcdSans changed,
+	// e.g. when a leaf is close to expiry rather than its SANs being stale.
+	Force bool
+
+	// CATrustOverlap is how long the previous CA is kept alongside the new one in ca.crt.
+	// Defaults to defaultCATrustOverlap.
+	CATrustOverlap time.Duration
+
+	// Certs carries the same store/external-CA configuration EnsureCertsWithOptions accepts, so
+	// rotation honors a configured CertStore or bring-your-own-CA/cert-manager setup instead of
+	// always writing private material to the plain Secret or minting a fresh local CA.
+	Certs CertsOptions
+}
+
+// RotateCerts regenerates the PKI for an existing vcluster without recreating it. If opts.RotateCA
+// is set, the CAs are rolled first (as RotateCA does) and the leaves are re-issued against the new ones.
+// Otherwise, if etcdSans, serviceCIDR or clusterDomain changed relative to what the certs were
+// last issued with, only the leaf certificates are re-issued against the existing CA. If nothing
+// changed, RotateCerts is a no-op. Private material is written through opts.Certs.Store exactly as
+// EnsureCertsWithOptions does, and CA slots covered by opts.Certs.ExternalCAs are re-seeded from
+// their external source instead of being minted locally.
+func RotateCerts(
+	ctx context.Context,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+	opts RotateOptions,
+) error {
+	secretName := vClusterName + "-certs"
+	secret, err := currentNamespaceClient.CoreV1().Secrets(currentNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get certs secret: %w", err)
+	}
+
+	store, err := newCertStore(ctx, opts.Certs.Store, currentNamespaceClient, currentNamespace, vClusterName)
+	if err != nil {
+		return fmt.Errorf("build cert store: %w", err)
+	}
+
+	cfg, sansChanged, err := rebuildInitConfiguration(secret, vClusterName, certificateDir, opts)
+	if err != nil {
+		return fmt.Errorf("rebuild init configuration: %w", err)
+	}
+
+	var oldCACerts map[string][]byte
+	if opts.RotateCA {
+		oldCACerts, err = backupAndClearCAFiles(ctx, currentNamespaceClient, currentNamespace, certificateDir, opts.Certs.ExternalCAs)
+		if err != nil {
+			return fmt.Errorf("rotate ca: %w", err)
+		}
+	} else if !sansChanged && !opts.Force {
+		klog.Infof("certs for vcluster %s/%s are already up to date, nothing to rotate", currentNamespace, vClusterName)
+		return nil
+	}
+
+	if err := createPKIAssets(cfg, opts.Certs.ExternalCAs); err != nil {
+		return fmt.Errorf("create pki assets: %w", err)
+	}
+
+	var overlapUntil time.Time
+	if len(oldCACerts) > 0 {
+		overlap := opts.CATrustOverlap
+		if overlap <= 0 {
+			overlap = defaultCATrustOverlap
+		}
+		if err := bundleCATrustOverlap(certificateDir, oldCACerts); err != nil {
+			return fmt.Errorf("bundle ca trust overlap: %w", err)
+		}
+		overlapUntil = time.Now().Add(overlap)
+		klog.Infof("rotated CA for vcluster %s/%s, previous CA remains trusted in the bundle until %s", currentNamespace, vClusterName, overlapUntil)
+	}
+
+	return rotateLeaves(ctx, currentNamespace, currentNamespaceClient, vClusterName, certificateDir, cfg, store, opts.Certs, overlapUntil)
+}
+
+// RotateCA mints a new CA for an existing vcluster, keeping the previous one trusted alongside it
+// for opts.CATrustOverlap, and re-issues every leaf certificate against the new CA. This mirrors
+// the recert approach cluster-etcd-operator uses for full CA rollovers. CA slots covered by
+// opts.Certs.ExternalCAs are re-seeded from their external source instead of being minted locally,
+// since that CA isn't vcluster's to rotate.
+func RotateCA(
+	ctx context.Context,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+	opts RotateOptions,
+) error {
+	opts.RotateCA = true
+	return RotateCerts(ctx, currentNamespace, currentNamespaceClient, vClusterName, certificateDir, opts)
+}
+
+// backupAndClearCAFiles reads the existing CA certs and removes the CA files for any slot not
+// governed by cas, so the next CreatePKIAssets call is forced to mint a brand-new CA for it.
+// Slots covered by cas are re-seeded from their external source instead: their CA isn't
+// vcluster's to rotate, so rolling it locally would silently replace the customer-supplied or
+// cert-manager-issued trust root.
+func backupAndClearCAFiles(
+	ctx context.Context,
+	client kubernetes.Interface,
+	namespace string,
+	certificateDir string,
+	cas *ExternalCAs,
+) (map[string][]byte, error) {
+	oldCerts := make(map[string][]byte, len(caSlots))
+
+	for _, slot := range caSlots {
+		if ca := externalCAFor(slot.name, cas); ca != nil {
+			if err := seedExternalCA(ctx, client, namespace, certificateDir, ca, slot.certFile, slot.keyFile); err != nil {
+				return nil, fmt.Errorf("re-seed external %s ca: %w", slot.name, err)
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(certificateDir, slot.certFile))
+		if err != nil {
+			return nil, fmt.Errorf("read existing %s: %w", slot.certFile, err)
+		}
+		oldCerts[slot.certFile] = data
+
+		for _, f := range []string{slot.certFile, slot.keyFile} {
+			if err := os.Remove(filepath.Join(certificateDir, f)); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("remove old %s: %w", f, err)
+			}
+		}
+	}
+
+	return oldCerts, nil
+}
+
+// bundleCATrustOverlap appends each old CA cert after the freshly-minted one on disk, so clients
+// that cached the old trust bundle keep working until PruneCATrustOverlap drops it.
+func bundleCATrustOverlap(certificateDir string, oldCerts map[string][]byte) error {
+	for f, oldCert := range oldCerts {
+		path := filepath.Join(certificateDir, f)
+		newCert, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read new %s: %w", f, err)
+		}
+
+		bundle := append(bytes.TrimSpace(newCert), '\n')
+		bundle = append(bundle, bytes.TrimSpace(oldCert)...)
+		bundle = append(bundle, '\n')
+		if err := os.WriteFile(path, bundle, 0644); err != nil {
+			return fmt.Errorf("write %s trust bundle: %w", f, err)
+		}
+	}
+
+	return nil
+}
+
+// PruneCATrustOverlap drops the previous CA from every bundled ca.crt file (and the certs
+// Secret) once the trust-overlap window RotateCA recorded in annotationCATrustOverlapUntil has
+// elapsed. It is a no-op if no rotation has an overlap currently in effect, or the window hasn't
+// elapsed yet. CertMonitor calls it on every tick.
+func PruneCATrustOverlap(
+	ctx context.Context,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+) error {
+	secretName := vClusterName + "-certs"
+	secret, err := currentNamespaceClient.CoreV1().Secrets(currentNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get certs secret: %w", err)
+	}
+
+	until, ok := secret.Annotations[annotationCATrustOverlapUntil]
+	if !ok || until == "" {
+		return nil
+	}
+
+	overlapUntil, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return fmt.Errorf("parse %s annotation: %w", annotationCATrustOverlapUntil, err)
+	}
+	if time.Now().Before(overlapUntil) {
+		return nil
+	}
+
+	for _, slot := range caSlots {
+		if err := pruneToFirstCert(filepath.Join(certificateDir, slot.certFile)); err != nil {
+			return fmt.Errorf("prune %s: %w", slot.certFile, err)
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := currentNamespaceClient.CoreV1().Secrets(currentNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get certs secret: %w", err)
+		}
+
+		updated := secret.DeepCopy()
+		for _, slot := range caSlots {
+			toName, ok := certMap[slot.certFile]
+			if !ok {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(certificateDir, slot.certFile))
+			if err != nil {
+				return fmt.Errorf("read %s: %w", slot.certFile, err)
+			}
+			updated.Data[toName] = data
+		}
+		delete(updated.Annotations, annotationCATrustOverlapUntil)
+
+		_, err = currentNamespaceClient.CoreV1().Secrets(currentNamespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+
+		klog.Infof("pruned expired ca trust overlap for vcluster %s/%s", currentNamespace, vClusterName)
+		return nil
+	})
+}
+
+// pruneToFirstCert rewrites path to contain only the first PEM block, dropping any bundled
+// trust-overlap certs that follow it.
+func pruneToFirstCert(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, rest := pem.Decode(data)
+	if block == nil || len(bytes.TrimSpace(rest)) == 0 {
+		return nil
+	}
+
+	return atomicWriteFile(path, pem.EncodeToMemory(block), 0644)
+}
+
+// rotateLeaves re-issues every leaf certificate against whatever CA is currently on disk,
+// requests any leaves governed by a CAOnly/CertManagerIssuer CA in certsOpts.ExternalCAs, and rewrites
+// the kubeconfigs and the <vclustername>-certs Secret to match.
+func rotateLeaves(
+	ctx context.Context,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+	cfg *InitConfiguration,
+	store CertStore,
+	certsOpts CertsOptions,
+	overlapUntil time.Time,
+) error {
+	if !requiresCertManagerLeaves(externalCAFor("apiserver", certsOpts.ExternalCAs)) {
+		if err := CreateJoinControlPlaneKubeConfigFiles(cfg.CertificatesDir, cfg); err != nil {
+			return fmt.Errorf("create kube configs: %w", err)
+		}
+	}
+
+	if certsOpts.ExternalCAs != nil {
+		dnsNames, ips := apiServerSANs(cfg)
+		etcdSans := cfg.Etcd.Local.ServerCertSANs
+		if err := requestCertManagerCerts(ctx, certsOpts.CertManagerClient, currentNamespaceClient, currentNamespace, vClusterName, certificateDir, dnsNames, ips, etcdSans, certsOpts.ExternalCAs, cfg.ControlPlaneEndpoint); err != nil {
+			return fmt.Errorf("request certs from cert-manager: %w", err)
+		}
+	}
+
+	return updateCertsSecret(ctx, currentNamespace, currentNamespaceClient, vClusterName, certificateDir, cfg, store, overlapUntil)
+}
+
+// diffRotationInputs reconstructs the serviceCIDR/clusterDomain/etcdSans the certs were last
+// issued with from secret's annotations, applying any overrides from opts, and reports whether
+// any of them changed. It has no kubeadm dependency, unlike rebuildInitConfiguration, so it can
+// be unit tested directly.
+func diffRotationInputs(secret *corev1.Secret, opts RotateOptions) (serviceCIDR, clusterDomain string, etcdSans []string, changed bool) {
+	serviceCIDR = secret.Annotations[annotationServiceCIDR]
+	clusterDomain = secret.Annotations[annotationClusterDomain]
+	if v := secret.Annotations[annotationEtcdSans]; v != "" {
+		etcdSans = strings.Split(v, ",")
+	}
+
+	if opts.ServiceCIDR != "" && opts.ServiceCIDR != serviceCIDR {
+		serviceCIDR, changed = opts.ServiceCIDR, true
+	}
+	if opts.ClusterDomain != "" && opts.ClusterDomain != clusterDomain {
+		clusterDomain, changed = opts.ClusterDomain, true
+	}
+	if len(opts.EtcdSans) > 0 && !slices.Equal(opts.EtcdSans, etcdSans) {
+		etcdSans, changed = opts.EtcdSans, true
+	}
+
+	return serviceCIDR, clusterDomain, etcdSans, changed
+}
+
+// rebuildInitConfiguration reconstructs the kubeadm InitConfiguration the certs were originally
+// issued with from the secret's annotations, applying any overrides from opts. It reports whether
+// etcdSans, serviceCIDR or clusterDomain changed relative to what is stored.
+func rebuildInitConfiguration(
+	secret *corev1.Secret,
+	vClusterName string,
+	certificateDir string,
+	opts RotateOptions,
+) (*InitConfiguration, bool, error) {
+	cfg, err := SetInitDynamicDefaults()
+	if err != nil {
+		return nil, false, err
+	}
+
+	serviceCIDR, clusterDomain, etcdSans, sansChanged := diffRotationInputs(secret, opts)
+
+	cfg.ClusterName = "kubernetes"
+	cfg.NodeRegistration.Name = vClusterName
+	cfg.Etcd.Local = &LocalEtcd{
+		ServerCertSANs: etcdSans,
+		PeerCertSANs:   etcdSans,
+	}
+	cfg.Networking.ServiceSubnet = serviceCIDR
+	cfg.Networking.DNSDomain = clusterDomain
+	cfg.ControlPlaneEndpoint = "127.0.0.1:6443"
+	cfg.CertificatesDir = certificateDir
+	cfg.LocalAPIEndpoint.AdvertiseAddress = "0.0.0.0"
+	cfg.LocalAPIEndpoint.BindPort = 443
+
+	return cfg, sansChanged, nil
+}
+
+// updateCertsSecret rewrites the <vclustername>-certs Secret from certificateDir in a single
+// atomic Update call, retrying on conflict, and refreshes the rotation annotations so the next
+// RotateCerts call rebuilds the same configuration. Private material listed in
+// privateMaterialKeys is routed through store instead, exactly like EnsureCertsWithOptions does,
+// so a configured CertStore isn't bypassed on rotation.
+func updateCertsSecret(
+	ctx context.Context,
+	currentNamespace string,
+	currentNamespaceClient kubernetes.Interface,
+	vClusterName string,
+	certificateDir string,
+	cfg *InitConfiguration,
+	store CertStore,
+	overlapUntil time.Time,
+) error {
+	secretName := vClusterName + "-certs"
+
+	data := map[string][]byte{}
+	for fromName, toName := range certMap {
+		content, err := os.ReadFile(filepath.Join(certificateDir, fromName))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", fromName, err)
+		}
+
+		if store != nil && privateMaterialKeys[fromName] {
+			if err := store.Put(ctx, toName, content); err != nil {
+				return fmt.Errorf("put %s into cert store: %w", toName, err)
+			}
+			continue
+		}
+
+		data[toName] = content
+	}
+	extra, err := extraFiles(certificateDir)
+	if err != nil {
+		return fmt.Errorf("read extra file: %w", err)
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := currentNamespaceClient.CoreV1().Secrets(currentNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get certs secret: %w", err)
+		}
+
+		updated := secret.DeepCopy()
+		updated.Data = data
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[annotationServiceCIDR] = cfg.Networking.ServiceSubnet
+		updated.Annotations[annotationClusterDomain] = cfg.Networking.DNSDomain
+		if cfg.Etcd.Local != nil {
+			updated.Annotations[annotationEtcdSans] = strings.Join(cfg.Etcd.Local.ServerCertSANs, ",")
+		}
+		// A zero overlapUntil leaves any overlap already in effect untouched, so
+		// PruneCATrustOverlap still drops the previous CA once that window elapses.
+		if !overlapUntil.IsZero() {
+			updated.Annotations[annotationCATrustOverlapUntil] = overlapUntil.Format(time.RFC3339)
+		}
+
+		_, err = currentNamespaceClient.CoreV1().Secrets(currentNamespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+
+		klog.Infof("successfully rotated certs secret %s/%s", currentNamespace, secretName)
+		return nil
+	})
+}
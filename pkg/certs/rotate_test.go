@@ -0,0 +1,368 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffRotationInputs(t *testing.T) {
+	baseSecret := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					annotationServiceCIDR:   "10.96.0.0/12",
+					annotationClusterDomain: "cluster.local",
+					annotationEtcdSans:      "etcd-0,etcd-1",
+				},
+			},
+		}
+	}
+
+	t.Run("nothing overridden, nothing changed", func(t *testing.T) {
+		serviceCIDR, clusterDomain, etcdSans, changed := diffRotationInputs(baseSecret(), RotateOptions{})
+		if changed {
+			t.Fatalf("expected changed=false, got true")
+		}
+		if serviceCIDR != "10.96.0.0/12" || clusterDomain != "cluster.local" {
+			t.Fatalf("unexpected values: %s, %s", serviceCIDR, clusterDomain)
+		}
+		if len(etcdSans) != 2 || etcdSans[0] != "etcd-0" || etcdSans[1] != "etcd-1" {
+			t.Fatalf("unexpected etcdSans: %v", etcdSans)
+		}
+	})
+
+	t.Run("serviceCIDR override differs", func(t *testing.T) {
+		_, _, _, changed := diffRotationInputs(baseSecret(), RotateOptions{ServiceCIDR: "10.32.0.0/12"})
+		if !changed {
+			t.Fatalf("expected changed=true when serviceCIDR override differs")
+		}
+	})
+
+	t.Run("serviceCIDR override matches existing, no change", func(t *testing.T) {
+		_, _, _, changed := diffRotationInputs(baseSecret(), RotateOptions{ServiceCIDR: "10.96.0.0/12"})
+		if changed {
+			t.Fatalf("expected changed=false when override matches existing value")
+		}
+	})
+
+	t.Run("clusterDomain override differs", func(t *testing.T) {
+		_, clusterDomain, _, changed := diffRotationInputs(baseSecret(), RotateOptions{ClusterDomain: "vcluster.local"})
+		if !changed || clusterDomain != "vcluster.local" {
+			t.Fatalf("expected changed=true with new clusterDomain, got changed=%v clusterDomain=%s", changed, clusterDomain)
+		}
+	})
+
+	t.Run("etcdSans override differs", func(t *testing.T) {
+		_, _, etcdSans, changed := diffRotationInputs(baseSecret(), RotateOptions{EtcdSans: []string{"etcd-0", "etcd-1", "etcd-2"}})
+		if !changed || len(etcdSans) != 3 {
+			t.Fatalf("expected changed=true with 3 etcdSans, got changed=%v etcdSans=%v", changed, etcdSans)
+		}
+	})
+
+	t.Run("etcdSans override matches existing, no change", func(t *testing.T) {
+		_, _, _, changed := diffRotationInputs(baseSecret(), RotateOptions{EtcdSans: []string{"etcd-0", "etcd-1"}})
+		if changed {
+			t.Fatalf("expected changed=false when etcdSans override matches existing value")
+		}
+	})
+
+	t.Run("no annotations on secret", func(t *testing.T) {
+		serviceCIDR, clusterDomain, etcdSans, changed := diffRotationInputs(&corev1.Secret{}, RotateOptions{})
+		if changed || serviceCIDR != "" || clusterDomain != "" || etcdSans != nil {
+			t.Fatalf("expected all zero values for a secret with no annotations, got serviceCIDR=%q clusterDomain=%q etcdSans=%v changed=%v",
+				serviceCIDR, clusterDomain, etcdSans, changed)
+		}
+	})
+}
+
+func TestBackupAndClearCAFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, slot := range caSlots {
+		certPath := filepath.Join(dir, slot.certFile)
+		if err := os.MkdirAll(filepath.Dir(certPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(certPath, []byte("old-cert-"+slot.name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, slot.keyFile), []byte("old-key-"+slot.name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.NewSimpleClientset()
+
+	oldCerts, err := backupAndClearCAFiles(context.Background(), client, "ns", dir, nil)
+	if err != nil {
+		t.Fatalf("backupAndClearCAFiles: %v", err)
+	}
+
+	if len(oldCerts) != len(caSlots) {
+		t.Fatalf("expected %d old certs backed up, got %d", len(caSlots), len(oldCerts))
+	}
+	for _, slot := range caSlots {
+		if string(oldCerts[slot.certFile]) != "old-cert-"+slot.name {
+			t.Errorf("unexpected backed up cert for %s", slot.certFile)
+		}
+		if _, err := os.Stat(filepath.Join(dir, slot.certFile)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", slot.certFile)
+		}
+		if _, err := os.Stat(filepath.Join(dir, slot.keyFile)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", slot.keyFile)
+		}
+	}
+}
+
+func TestBackupAndClearCAFilesReseedsExternallyManagedSlot(t *testing.T) {
+	dir := t.TempDir()
+	for _, slot := range caSlots {
+		certPath := filepath.Join(dir, slot.certFile)
+		if err := os.MkdirAll(filepath.Dir(certPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(certPath, []byte("old-cert-"+slot.name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, slot.keyFile), []byte("old-key-"+slot.name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newCA := selfSignedCertPEM(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "external-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-ca", Namespace: "ns"},
+		Data:       map[string][]byte{"ca.crt": newCA, "ca.key": []byte("external-key")},
+	})
+
+	cas := &ExternalCAs{APIServer: &ExternalCA{Mode: ExternalCAModeFromSecret, SecretRef: &corev1.SecretReference{Name: "external-ca"}}}
+
+	oldCerts, err := backupAndClearCAFiles(context.Background(), client, "ns", dir, cas)
+	if err != nil {
+		t.Fatalf("backupAndClearCAFiles: %v", err)
+	}
+
+	if _, ok := oldCerts["ca.crt"]; ok {
+		t.Errorf("expected apiserver ca.crt to be skipped from oldCerts since it's externally managed")
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("read re-seeded ca.crt: %v", err)
+	}
+	if string(got) != string(newCA) {
+		t.Errorf("expected ca.crt to be re-seeded from the external secret")
+	}
+
+	if _, ok := oldCerts["front-proxy-ca.crt"]; !ok {
+		t.Errorf("expected front-proxy-ca.crt to still be backed up since it isn't externally managed")
+	}
+}
+
+func TestPruneCATrustOverlap(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	newCert := selfSignedCertPEM(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "new"},
+		NotBefore: now, NotAfter: now.Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	})
+	oldCert := selfSignedCertPEM(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "old"},
+		NotBefore: now, NotAfter: now.Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	})
+
+	for _, slot := range caSlots {
+		path := filepath.Join(dir, slot.certFile)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		bundle := append(append([]byte{}, newCert...), oldCert...)
+		if err := os.WriteFile(path, bundle, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-vcluster-certs",
+			Namespace: "ns",
+			Annotations: map[string]string{
+				annotationCATrustOverlapUntil: time.Now().Add(-time.Hour).Format(time.RFC3339),
+			},
+		},
+		Data: map[string][]byte{},
+	})
+
+	if err := PruneCATrustOverlap(context.Background(), "ns", client, "my-vcluster", dir); err != nil {
+		t.Fatalf("PruneCATrustOverlap: %v", err)
+	}
+
+	for _, slot := range caSlots {
+		data, err := os.ReadFile(filepath.Join(dir, slot.certFile))
+		if err != nil {
+			t.Fatalf("read %s: %v", slot.certFile, err)
+		}
+		if string(data) != string(newCert) {
+			t.Errorf("%s: expected bundle pruned down to just the new cert", slot.certFile)
+		}
+	}
+
+	secret, err := client.CoreV1().Secrets("ns").Get(context.Background(), "my-vcluster-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if _, ok := secret.Annotations[annotationCATrustOverlapUntil]; ok {
+		t.Errorf("expected overlap annotation to be removed after pruning")
+	}
+}
+
+func TestPruneCATrustOverlapNotYetElapsed(t *testing.T) {
+	dir := t.TempDir()
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-vcluster-certs",
+			Namespace: "ns",
+			Annotations: map[string]string{
+				annotationCATrustOverlapUntil: time.Now().Add(time.Hour).Format(time.RFC3339),
+			},
+		},
+	})
+
+	if err := PruneCATrustOverlap(context.Background(), "ns", client, "my-vcluster", dir); err != nil {
+		t.Fatalf("PruneCATrustOverlap: %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("ns").Get(context.Background(), "my-vcluster-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if _, ok := secret.Annotations[annotationCATrustOverlapUntil]; !ok {
+		t.Errorf("expected overlap annotation to remain when the window hasn't elapsed yet")
+	}
+}
+
+// fakeCertStore is an in-memory CertStore used to verify updateCertsSecret routes private
+// material through the store without needing a real backend.
+type fakeCertStore struct {
+	data map[string][]byte
+}
+
+func newFakeCertStore() *fakeCertStore {
+	return &fakeCertStore{data: map[string][]byte{}}
+}
+
+func (f *fakeCertStore) Get(_ context.Context, key string) ([]byte, error) {
+	v, ok := f.data[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (f *fakeCertStore) Put(_ context.Context, key string, value []byte) error {
+	f.data[key] = value
+	return nil
+}
+
+func (f *fakeCertStore) List(_ context.Context) ([]string, error) {
+	keys := make([]string, 0, len(f.data))
+	for k := range f.data {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (f *fakeCertStore) Delete(_ context.Context, key string) error {
+	delete(f.data, key)
+	return nil
+}
+
+func (f *fakeCertStore) Exists(_ context.Context, key string) (bool, error) {
+	_, ok := f.data[key]
+	return ok, nil
+}
+
+func TestUpdateCertsSecretRoutesPrivateMaterialToStore(t *testing.T) {
+	dir := t.TempDir()
+	for fromName := range certMap {
+		path := filepath.Join(dir, fromName)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("content-"+fromName), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-vcluster-certs", Namespace: "ns"},
+		Data:       map[string][]byte{},
+	})
+
+	store := newFakeCertStore()
+	cfg := &InitConfiguration{}
+	cfg.Networking.ServiceSubnet = "10.96.0.0/12"
+	cfg.Networking.DNSDomain = "cluster.local"
+	cfg.Etcd.Local = &LocalEtcd{ServerCertSANs: []string{"etcd-0"}}
+
+	if err := updateCertsSecret(context.Background(), "ns", client, "my-vcluster", dir, cfg, store, time.Time{}); err != nil {
+		t.Fatalf("updateCertsSecret: %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("ns").Get(context.Background(), "my-vcluster-certs", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+
+	for fromName, toName := range certMap {
+		want := "content-" + fromName
+		if privateMaterialKeys[fromName] {
+			got, err := store.Get(context.Background(), toName)
+			if err != nil {
+				t.Fatalf("get %s from store: %v", toName, err)
+			}
+			if string(got) != want {
+				t.Errorf("store %s = %q, want %q", toName, got, want)
+			}
+			if _, ok := secret.Data[toName]; ok {
+				t.Errorf("private key %s leaked into the plain secret", toName)
+			}
+			continue
+		}
+
+		if string(secret.Data[toName]) != want {
+			t.Errorf("secret.Data[%s] = %q, want %q", toName, secret.Data[toName], want)
+		}
+	}
+
+	if secret.Annotations[annotationServiceCIDR] != "10.96.0.0/12" {
+		t.Errorf("expected annotationServiceCIDR to be refreshed, got %q", secret.Annotations[annotationServiceCIDR])
+	}
+	if secret.Annotations[annotationClusterDomain] != "cluster.local" {
+		t.Errorf("expected annotationClusterDomain to be refreshed, got %q", secret.Annotations[annotationClusterDomain])
+	}
+	if secret.Annotations[annotationEtcdSans] != "etcd-0" {
+		t.Errorf("expected annotationEtcdSans to be refreshed, got %q", secret.Annotations[annotationEtcdSans])
+	}
+}
@@ -0,0 +1,187 @@
+package certs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/exp/maps"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// ErrKeyNotFound is returned by a CertStore when the requested key does not exist.
+var ErrKeyNotFound = errors.New("key not found in cert store")
+
+// CertStore abstracts where PKI material is persisted, so compliance-sensitive users can keep
+// private key material (CA keys, sa.key) out of a plain Kubernetes Secret. Keys are the same
+// names used in the <vclustername>-certs Secret's data map, e.g. "ca.key" or "sa.key".
+type CertStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+const (
+	StoreTypeSecret = "secret"
+	StoreTypeVault  = "vault"
+)
+
+// StoreConfig mirrors the vcluster values under certs.store.
+type StoreConfig struct {
+	// Type selects the CertStore implementation: "secret" (default) or "vault".
+	Type string `json:"type,omitempty"`
+	// Vault configures the store when Type is "vault".
+	Vault VaultConfig `json:"vault,omitempty"`
+}
+
+// privateMaterialKeys are the certMap "fromName" entries (on-disk filenames) that must never be
+// left in a plain Secret when a dedicated CertStore is configured: ca.key, front-proxy-ca.key,
+// sa.key and the etcd CA key are the ones compliance teams care about keeping in a KMS.
+var privateMaterialKeys = map[string]bool{
+	"ca.key":             true,
+	"front-proxy-ca.key": true,
+	"sa.key":             true,
+	"etcd/ca.key":        true,
+}
+
+// newCertStore builds the CertStore private PKI material should be persisted to, based on
+// storeCfg. StoreTypeSecret (the default) returns a nil CertStore, meaning private material
+// stays in the <vclustername>-certs Secret exactly like it always has.
+func newCertStore(
+	ctx context.Context,
+	storeCfg StoreConfig,
+	client kubernetes.Interface,
+	namespace string,
+	vClusterName string,
+) (CertStore, error) {
+	switch storeCfg.Type {
+	case "", StoreTypeSecret:
+		return nil, nil
+	case StoreTypeVault:
+		return NewVaultCertStore(ctx, storeCfg.Vault, client, namespace)
+	default:
+		return nil, fmt.Errorf("unknown certs store type %q", storeCfg.Type)
+	}
+}
+
+// SecretCertStore is the default CertStore, backed by the <vclustername>-certs Secret. It exists
+// so other stores can be migrated to/from the same Secret EnsureCerts has always used.
+type SecretCertStore struct {
+	client     kubernetes.Interface
+	namespace  string
+	secretName string
+}
+
+// NewSecretCertStore returns a CertStore backed by the <vClusterName>-certs Secret.
+func NewSecretCertStore(client kubernetes.Interface, namespace, vClusterName string) *SecretCertStore {
+	return &SecretCertStore{
+		client:     client,
+		namespace:  namespace,
+		secretName: vClusterName + "-certs",
+	}
+}
+
+func (s *SecretCertStore) Get(ctx context.Context, key string) ([]byte, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrKeyNotFound)
+	}
+	return data, nil
+}
+
+func (s *SecretCertStore) Put(ctx context.Context, key string, value []byte) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.secretName, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: s.secretName, Namespace: s.namespace},
+				Data:       map[string][]byte{key: value},
+			}
+			_, err = s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[key] = value
+
+		_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (s *SecretCertStore) List(ctx context.Context) ([]string, error) {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return maps.Keys(secret.Data), nil
+}
+
+func (s *SecretCertStore) Delete(ctx context.Context, key string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.secretName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		delete(secret.Data, key)
+
+		_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (s *SecretCertStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Get(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MigrateCertStore copies the keys src.List returns whose on-disk name (see secretFileName) is in
+// privateMaterialKeys from src into dst. Use it to move the private PKI material from a SecretCertStore to a VaultCertStore (or
+// back) without regenerating the PKI. Public certs are deliberately left out: they stay in the
+// <vclustername>-certs Secret by design (see privateMaterialKeys), so a blanket copy of every key
+// src.List returns would leak them into dst too.
+func MigrateCertStore(ctx context.Context, src, dst CertStore) error {
+	keys, err := src.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list source store: %w", err)
+	}
+
+	for _, key := range keys {
+		if !privateMaterialKeys[secretFileName(key)] {
+			continue
+		}
+
+		value, err := src.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("read %s from source store: %w", key, err)
+		}
+		if err := dst.Put(ctx, key, value); err != nil {
+			return fmt.Errorf("write %s to destination store: %w", key, err)
+		}
+	}
+
+	return nil
+}
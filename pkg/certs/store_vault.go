@@ -0,0 +1,249 @@
+package certs
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// VaultAuthMethod selects how VaultCertStore authenticates against Vault.
+type VaultAuthMethod string
+
+const (
+	VaultAuthKubernetes VaultAuthMethod = "kubernetes"
+	VaultAuthToken      VaultAuthMethod = "token"
+)
+
+// VaultConfig configures a VaultCertStore, matching the vcluster values under
+// certs.store.vault.
+type VaultConfig struct {
+	Address    string          `json:"address,omitempty"`
+	MountPath  string          `json:"mountPath,omitempty"`
+	Role       string          `json:"role,omitempty"`
+	AuthMethod VaultAuthMethod `json:"authMethod,omitempty"`
+
+	// Token is the Vault token to use when AuthMethod is VaultAuthToken.
+	Token string `json:"token,omitempty"`
+
+	// TLSSecretRef references a Secret with ca.crt/tls.crt/tls.key for mTLS to Vault, mirroring
+	// how rook-ceph wires full TLS to Vault.
+	TLSSecretRef *corev1.SecretReference `json:"tlsSecretRef,omitempty"`
+}
+
+// VaultCertStore stores PKI material in a Vault KV v2 mount, keyed the same way as the
+// <vclustername>-certs Secret's data map (e.g. "ca.key").
+type VaultCertStore struct {
+	client    *vaultapi.Client
+	mountPath string
+}
+
+// NewVaultCertStore builds a VaultCertStore from cfg, authenticating against Vault using
+// cfg.AuthMethod.
+func NewVaultCertStore(
+	ctx context.Context,
+	cfg VaultConfig,
+	k8sClient kubernetes.Interface,
+	namespace string,
+) (*VaultCertStore, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("vault store requires an address")
+	}
+	if cfg.MountPath == "" {
+		return nil, fmt.Errorf("vault store requires a mountPath")
+	}
+
+	vaultCfg := vaultapi.DefaultConfig()
+	vaultCfg.Address = cfg.Address
+
+	if cfg.TLSSecretRef != nil {
+		if err := configureVaultTLS(ctx, vaultCfg, k8sClient, namespace, cfg.TLSSecretRef.Name); err != nil {
+			return nil, fmt.Errorf("configure vault tls: %w", err)
+		}
+	}
+
+	client, err := vaultapi.NewClient(vaultCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create vault client: %w", err)
+	}
+
+	if err := authenticateVault(ctx, client, cfg); err != nil {
+		return nil, fmt.Errorf("authenticate to vault: %w", err)
+	}
+
+	return &VaultCertStore{client: client, mountPath: cfg.MountPath}, nil
+}
+
+// configureVaultTLS loads ca.crt/tls.crt/tls.key from the referenced Secret and wires them into
+// vaultCfg for mTLS. tls.crt/tls.key, if present, are written to a temp dir since the Vault
+// client API expects file paths for client certs.
+func configureVaultTLS(ctx context.Context, vaultCfg *vaultapi.Config, k8sClient kubernetes.Interface, namespace, secretName string) error {
+	secret, err := k8sClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get tls secret %s: %w", secretName, err)
+	}
+
+	tlsCfg := &vaultapi.TLSConfig{CACertBytes: secret.Data["ca.crt"]}
+
+	if clientCert, ok := secret.Data["tls.crt"]; ok {
+		clientKey, ok := secret.Data["tls.key"]
+		if !ok {
+			return fmt.Errorf("secret %s has tls.crt but no tls.key", secretName)
+		}
+
+		certFile, err := writeTempFile("vault-client-*.crt", clientCert)
+		if err != nil {
+			return err
+		}
+		keyFile, err := writeTempFile("vault-client-*.key", clientKey)
+		if err != nil {
+			return err
+		}
+
+		tlsCfg.ClientCert = certFile
+		tlsCfg.ClientKey = keyFile
+	}
+
+	return vaultCfg.ConfigureTLS(tlsCfg)
+}
+
+func writeTempFile(pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		return "", fmt.Errorf("chmod temp file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("write temp file: %w", err)
+	}
+
+	return f.Name(), nil
+}
+
+// authenticateVault logs in using cfg.AuthMethod and sets the resulting token on client.
+func authenticateVault(ctx context.Context, client *vaultapi.Client, cfg VaultConfig) error {
+	switch cfg.AuthMethod {
+	case VaultAuthKubernetes:
+		jwt, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
+		if err != nil {
+			return fmt.Errorf("read service account token: %w", err)
+		}
+
+		secret, err := client.Logical().WriteWithContext(ctx, path.Join("auth", "kubernetes", "login"), map[string]interface{}{
+			"role": cfg.Role,
+			"jwt":  string(jwt),
+		})
+		if err != nil {
+			return fmt.Errorf("kubernetes auth login: %w", err)
+		}
+		if secret == nil || secret.Auth == nil {
+			return fmt.Errorf("kubernetes auth login returned no token")
+		}
+
+		client.SetToken(secret.Auth.ClientToken)
+		return nil
+	case VaultAuthToken, "":
+		if cfg.Token == "" {
+			return fmt.Errorf("token auth method requires a token")
+		}
+		client.SetToken(cfg.Token)
+		return nil
+	default:
+		return fmt.Errorf("unsupported vault auth method %q", cfg.AuthMethod)
+	}
+}
+
+func (v *VaultCertStore) Get(ctx context.Context, key string) ([]byte, error) {
+	secret, err := v.client.Logical().ReadWithContext(ctx, path.Join(v.mountPath, "data", key))
+	if err != nil {
+		return nil, fmt.Errorf("read %s from vault: %w", key, err)
+	}
+
+	encoded, ok := vaultKVv2Value(secret)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrKeyNotFound)
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (v *VaultCertStore) Put(ctx context.Context, key string, value []byte) error {
+	_, err := v.client.Logical().WriteWithContext(ctx, path.Join(v.mountPath, "data", key), map[string]interface{}{
+		"data": map[string]interface{}{
+			"value": base64.StdEncoding.EncodeToString(value),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("write %s to vault: %w", key, err)
+	}
+	return nil
+}
+
+func (v *VaultCertStore) List(ctx context.Context) ([]string, error) {
+	secret, err := v.client.Logical().ListWithContext(ctx, path.Join(v.mountPath, "metadata"))
+	if err != nil {
+		return nil, fmt.Errorf("list vault keys: %w", err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	raw, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(raw))
+	for _, k := range raw {
+		if s, ok := k.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	return keys, nil
+}
+
+func (v *VaultCertStore) Delete(ctx context.Context, key string) error {
+	_, err := v.client.Logical().DeleteWithContext(ctx, path.Join(v.mountPath, "metadata", key))
+	if err != nil {
+		return fmt.Errorf("delete %s from vault: %w", key, err)
+	}
+	return nil
+}
+
+func (v *VaultCertStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := v.Get(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// vaultKVv2Value extracts the base64-encoded "value" field this store writes under a KV v2
+// "data/data" response.
+func vaultKVv2Value(secret *vaultapi.Secret) (string, bool) {
+	if secret == nil || secret.Data == nil {
+		return "", false
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	value, ok := data["value"].(string)
+	return value, ok
+}
@@ -0,0 +1,38 @@
+package certs
+
+import (
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func TestVaultKVv2Value(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret *vaultapi.Secret
+		want   string
+		wantOK bool
+	}{
+		{name: "nil secret", secret: nil, wantOK: false},
+		{name: "nil data", secret: &vaultapi.Secret{}, wantOK: false},
+		{name: "missing data field", secret: &vaultapi.Secret{Data: map[string]interface{}{}}, wantOK: false},
+		{name: "data field not a map", secret: &vaultapi.Secret{Data: map[string]interface{}{"data": "oops"}}, wantOK: false},
+		{name: "missing value field", secret: &vaultapi.Secret{Data: map[string]interface{}{"data": map[string]interface{}{}}}, wantOK: false},
+		{name: "value not a string", secret: &vaultapi.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"value": 123}}}, wantOK: false},
+		{
+			name:   "valid kv v2 response",
+			secret: &vaultapi.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"value": "YWJj"}}},
+			want:   "YWJj",
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := vaultKVv2Value(tt.secret)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("vaultKVv2Value() = (%q, %v), want (%q, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
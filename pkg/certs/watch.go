@@ -0,0 +1,236 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"golang.org/x/exp/maps"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// CertChange is emitted on a CertWatcher subscription whenever a file under certificateDir is
+// rewritten because the backing Secret changed.
+type CertChange struct {
+	// File is the absolute path that was rewritten.
+	File string
+}
+
+// CertWatcher follows the <vclustername>-certs Secret with a shared informer and keeps
+// certificateDir in sync with it, so components started against the old certs can reload them
+// without the vcluster control plane pod restarting.
+type CertWatcher struct {
+	certificateDir string
+
+	mu          sync.Mutex
+	subscribers []chan CertChange
+}
+
+// NewCertWatcher builds a CertWatcher that keeps certificateDir in sync. Call Start to begin
+// watching; it blocks until ctx is done, so run it in its own goroutine.
+func NewCertWatcher(certificateDir string) *CertWatcher {
+	return &CertWatcher{certificateDir: certificateDir}
+}
+
+// Subscribe returns a channel that receives a CertChange for every file CertWatcher rewrites.
+// The channel is closed once Start's context is done.
+func (w *CertWatcher) Subscribe() <-chan CertChange {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch := make(chan CertChange, 16)
+	w.subscribers = append(w.subscribers, ch)
+	return ch
+}
+
+// Start runs the informer against the namespace/vClusterName certs Secret until ctx is done.
+func (w *CertWatcher) Start(ctx context.Context, client kubernetes.Interface, namespace, vClusterName string) error {
+	secretName := vClusterName + "-certs"
+	selector := fields.OneTermEqualSelector("metadata.name", secretName).String()
+
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return client.CoreV1().Secrets(namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return client.CoreV1().Secrets(namespace).Watch(ctx, options)
+		},
+	}
+
+	_, informer := cache.NewInformer(listWatch, &corev1.Secret{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.onSecret,
+		UpdateFunc: func(_, obj interface{}) { w.onSecret(obj) },
+	})
+
+	informer.Run(ctx.Done())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range w.subscribers {
+		close(ch)
+	}
+
+	return nil
+}
+
+func (w *CertWatcher) onSecret(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	changed, err := w.reconcile(secret)
+	if err != nil {
+		klog.Errorf("reconcile certs from secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, file := range changed {
+		for _, ch := range w.subscribers {
+			select {
+			case ch <- CertChange{File: file}:
+			default:
+				klog.Warningf("cert watcher subscriber channel full, dropping change for %s", file)
+			}
+		}
+	}
+}
+
+// reconcile diffs secret.Data against what's on disk using secretIsUpToDate and atomically
+// rewrites anything that changed, returning the absolute paths it touched.
+func (w *CertWatcher) reconcile(secret *corev1.Secret) ([]string, error) {
+	onDisk := make(map[string][]byte, len(secret.Data))
+	for secretEntry := range secret.Data {
+		data, err := os.ReadFile(filepath.Join(w.certificateDir, secretFileName(secretEntry)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read %s: %w", secretFileName(secretEntry), err)
+		}
+		onDisk[secretEntry] = data
+	}
+
+	if secretIsUpToDate(*secret, onDisk) {
+		return nil, nil
+	}
+
+	var changed []string
+	for secretEntry, fileBytes := range secret.Data {
+		if slices.Equal(onDisk[secretEntry], fileBytes) {
+			continue
+		}
+
+		path := filepath.Join(w.certificateDir, secretFileName(secretEntry))
+		if err := atomicWriteFile(path, fileBytes, 0666); err != nil {
+			return nil, fmt.Errorf("write %s: %w", path, err)
+		}
+		changed = append(changed, path)
+	}
+
+	return changed, nil
+}
+
+// secretFileName maps a secret data key back to the on-disk filename, mirroring
+// downloadCertsFromSecret.
+func secretFileName(secretEntry string) string {
+	if slices.Contains(maps.Values(certMap), secretEntry) {
+		for key, sEntry := range certMap {
+			if sEntry == secretEntry {
+				return key
+			}
+		}
+	}
+	return secretEntry
+}
+
+// atomicWriteFile writes to a temp file in the same directory and renames it into place, so a
+// reader never observes a partially written cert. This mirrors how kubelet's dynamic file
+// certificate manager reloads keypairs from disk.
+func atomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// DynamicCertificate wraps a certificate/key pair that CertWatcher keeps up to date on disk and
+// exposes it as a tls.Config.GetCertificate callback, so components that support it (apiserver,
+// etcd, controller-manager) pick up rotated leaf certs without restarting.
+type DynamicCertificate struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewDynamicCertificate loads certFile/keyFile once.
+func NewDynamicCertificate(certFile, keyFile string) (*DynamicCertificate, error) {
+	d := &DynamicCertificate{certFile: certFile, keyFile: keyFile}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload re-reads certFile/keyFile from disk.
+func (d *DynamicCertificate) Reload() error {
+	cert, err := tls.LoadX509KeyPair(d.certFile, d.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+
+	d.mu.Lock()
+	d.cert = &cert
+	d.mu.Unlock()
+
+	return nil
+}
+
+// GetCertificate satisfies tls.Config.GetCertificate.
+func (d *DynamicCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.cert, nil
+}
+
+// ReloadOnChange reloads d whenever a CertWatcher subscription reports a change to certFile or
+// keyFile. Run it in its own goroutine; it returns once changes is closed.
+func (d *DynamicCertificate) ReloadOnChange(changes <-chan CertChange) {
+	for change := range changes {
+		if change.File != d.certFile && change.File != d.keyFile {
+			continue
+		}
+		if err := d.Reload(); err != nil {
+			klog.Errorf("reload certificate %s: %v", d.certFile, err)
+		}
+	}
+}
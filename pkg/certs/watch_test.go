@@ -0,0 +1,139 @@
+package certs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretFileNameUnmapped(t *testing.T) {
+	if got := secretFileName("some-unmapped-key"); got != "some-unmapped-key" {
+		t.Fatalf("secretFileName for an unmapped key should return it unchanged, got %q", got)
+	}
+}
+
+func TestSecretFileNameMapped(t *testing.T) {
+	for fromName, toName := range certMap {
+		if got := secretFileName(toName); got != fromName {
+			t.Errorf("secretFileName(%q) = %q, want %q", toName, got, fromName)
+		}
+	}
+}
+
+func TestCertWatcherReconcile(t *testing.T) {
+	dir := t.TempDir()
+	w := NewCertWatcher(dir)
+
+	secret := &corev1.Secret{Data: map[string][]byte{"custom.pem": []byte("v1")}}
+
+	changed, err := w.reconcile(secret)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(changed) != 1 {
+		t.Fatalf("expected 1 changed file on first reconcile, got %v", changed)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "custom.pem"))
+	if err != nil {
+		t.Fatalf("read written file: %v", err)
+	}
+	if string(got) != "v1" {
+		t.Fatalf("expected written content %q, got %q", "v1", got)
+	}
+
+	changed, err = w.reconcile(secret)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("expected no changes on unchanged reconcile, got %v", changed)
+	}
+
+	secret.Data["custom.pem"] = []byte("v2")
+	changed, err = w.reconcile(secret)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(changed) != 1 {
+		t.Fatalf("expected 1 changed file after content changed, got %v", changed)
+	}
+
+	got, err = os.ReadFile(filepath.Join(dir, "custom.pem"))
+	if err != nil {
+		t.Fatalf("read rewritten file: %v", err)
+	}
+	if string(got) != "v2" {
+		t.Fatalf("expected rewritten content %q, got %q", "v2", got)
+	}
+}
+
+func TestCertWatcherStartAppliesSecretUpdates(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-vcluster-certs", Namespace: "ns"},
+		Data:       map[string][]byte{"custom.pem": []byte("v1")},
+	}
+	client := fake.NewSimpleClientset(secret)
+
+	dir := t.TempDir()
+	w := NewCertWatcher(dir)
+	sub := w.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = w.Start(ctx, client, "ns", "my-vcluster")
+	}()
+
+	select {
+	case change := <-sub:
+		if change.File != filepath.Join(dir, "custom.pem") {
+			t.Errorf("unexpected change file: %s", change.File)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for initial reconcile")
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "custom.pem"))
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if string(got) != "v1" {
+		t.Fatalf("unexpected content: %s", got)
+	}
+
+	updated := secret.DeepCopy()
+	updated.Data["custom.pem"] = []byte("v2")
+	if _, err := client.CoreV1().Secrets("ns").Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update secret: %v", err)
+	}
+
+	select {
+	case change := <-sub:
+		if change.File != filepath.Join(dir, "custom.pem") {
+			t.Errorf("unexpected change file: %s", change.File)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for update reconcile")
+	}
+
+	got, err = os.ReadFile(filepath.Join(dir, "custom.pem"))
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if string(got) != "v2" {
+		t.Fatalf("unexpected content after update: %s", got)
+	}
+
+	cancel()
+	<-done
+}